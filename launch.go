@@ -0,0 +1,35 @@
+package portapps
+
+import "github.com/portapps/portapps/v3/registry"
+
+// LaunchWithRegistryHive loads the hive at hivePath under mountPoint, runs
+// fn (the actual process launch/wait), then exports the hive back to
+// hivePath and unloads it, regardless of whether fn succeeded. This gives
+// CreateShortcut+CopyFolder-only containment its missing registry leg: the
+// app's HKCU writes land in the private hive for the run and are written
+// back to the portable app's own folder on exit.
+//
+// Nothing in this package calls this automatically: whatever
+// launcher-specific code runs the process is responsible for calling it
+// explicitly around that run, e.g.:
+//
+//	err := portapps.LaunchWithRegistryHive(AppPathJoin("app.reg"), "PortApp-"+Papp.Name, func() error {
+//		return runProcess(Papp.Path)
+//	})
+func LaunchWithRegistryHive(hivePath string, mountPoint string, fn func() error) error {
+	hive, err := registry.LoadHive(hivePath, mountPoint)
+	if err != nil {
+		return err
+	}
+
+	launchErr := fn()
+
+	if err := hive.Export(hivePath); err != nil && launchErr == nil {
+		launchErr = err
+	}
+	if err := hive.Close(); err != nil && launchErr == nil {
+		launchErr = err
+	}
+
+	return launchErr
+}
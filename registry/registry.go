@@ -0,0 +1,232 @@
+// Package registry lets a portapps launcher snapshot and restore a slice
+// of the Windows registry for the lifetime of a single run, so a portable
+// app's HKCU writes don't leak into the host machine's profile.
+//
+// A Hive is a registry file (a ".reg"-style hive, not a .reg text export)
+// loaded as a private, unnamed key for the duration of the launch, then
+// exported back to disk and unloaded on exit.
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	regForceRestore = 0x00000008 // REG_FORCE_RESTORE
+	regLatestFormat = 0x00000002 // REG_LATEST_FORMAT
+)
+
+var (
+	advapi32           = syscall.NewLazyDLL("advapi32.dll")
+	procRegLoadAppKeyW = advapi32.NewProc("RegLoadAppKeyW")
+	procRegSaveKeyExW  = advapi32.NewProc("RegSaveKeyExW")
+	procRegRestoreKeyW = advapi32.NewProc("RegRestoreKeyW")
+)
+
+// Hive is a registry hive file loaded as a private key for the duration
+// of a portable app's run.
+type Hive struct {
+	// MountPoint identifies this Hive instance for logging; it is no
+	// longer a real registry path, since RegLoadAppKeyW loads the hive
+	// as a private key rather than mounting it under HKEY_USERS.
+	MountPoint string
+	path       string
+	key        registry.Key
+}
+
+// LoadHive loads the hive file at path as a private key via
+// RegLoadAppKeyW, creating the hive file if it does not already exist.
+// Unlike RegLoadKeyW, this does not require SE_RESTORE_NAME/SE_BACKUP_NAME
+// privilege, so it works from a portable app's non-elevated process.
+// mountPoint is kept only as a label for Hive.MountPoint.
+func LoadHive(path string, mountPoint string) (*Hive, error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key syscall.Handle
+	r1, _, err := procRegLoadAppKeyW.Call(
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(&key)),
+		uintptr(registry.ALL_ACCESS),
+		0, // dwOptions: no REG_PROCESS_APPKEY, hive is unloaded on Close
+		0, // Reserved
+	)
+	if r1 != 0 {
+		return nil, fmt.Errorf("registry: RegLoadAppKeyW(%s): %w", path, syscall.Errno(r1))
+	}
+
+	return &Hive{MountPoint: mountPoint, path: path, key: registry.Key(key)}, nil
+}
+
+// Export saves the hive's current contents back to a hive file at path
+// via RegSaveKeyExW, using the latest on-disk hive format.
+func (h *Hive) Export(path string) error {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+
+	r1, _, err := procRegSaveKeyExW.Call(
+		uintptr(h.key),
+		uintptr(unsafe.Pointer(pathPtr)),
+		0, // lpSecurityAttributes
+		regLatestFormat,
+	)
+	if r1 != 0 {
+		return fmt.Errorf("registry: RegSaveKeyExW(%s): %w", path, syscall.Errno(r1))
+	}
+
+	return nil
+}
+
+// Import overwrites the hive's current contents from a hive file at path
+// via RegRestoreKeyW.
+func (h *Hive) Import(path string) error {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+
+	r1, _, err := procRegRestoreKeyW.Call(
+		uintptr(h.key),
+		uintptr(unsafe.Pointer(pathPtr)),
+		regForceRestore,
+	)
+	if r1 != 0 {
+		return fmt.Errorf("registry: RegRestoreKeyW(%s): %w", path, syscall.Errno(r1))
+	}
+
+	return nil
+}
+
+// Close unloads the hive. Keys loaded via RegLoadAppKeyW are unloaded
+// automatically when their handle is closed, unlike RegLoadKeyW hives,
+// which need a separate RegUnLoadKeyW call. The hive's contents should be
+// exported first if they need to persist past this call.
+func (h *Hive) Close() error {
+	return h.key.Close()
+}
+
+// ChangeKind describes how a value differs between two hive snapshots.
+type ChangeKind int
+
+const (
+	// Added means the value exists in after but not in before.
+	Added ChangeKind = iota
+	// Modified means the value exists in both but with a different value.
+	Modified
+	// Deleted means the value exists in before but not in after.
+	Deleted
+)
+
+// Change describes one value that differs between two Hive snapshots.
+type Change struct {
+	KeyPath   string
+	ValueName string
+	Kind      ChangeKind
+	OldValue  string
+	NewValue  string
+}
+
+// Diff walks before and after and reports every added, modified or
+// deleted value between the two hives.
+func Diff(before, after *Hive) ([]Change, error) {
+	var changes []Change
+
+	beforeValues := map[string]string{}
+	if err := collectValues(before.key, "", beforeValues); err != nil {
+		return nil, err
+	}
+	afterValues := map[string]string{}
+	if err := collectValues(after.key, "", afterValues); err != nil {
+		return nil, err
+	}
+
+	for k, newValue := range afterValues {
+		oldValue, existed := beforeValues[k]
+		if !existed {
+			changes = append(changes, splitChange(k, Added, "", newValue))
+		} else if oldValue != newValue {
+			changes = append(changes, splitChange(k, Modified, oldValue, newValue))
+		}
+	}
+	for k, oldValue := range beforeValues {
+		if _, stillExists := afterValues[k]; !stillExists {
+			changes = append(changes, splitChange(k, Deleted, oldValue, ""))
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].KeyPath+changes[i].ValueName < changes[j].KeyPath+changes[j].ValueName
+	})
+
+	return changes, nil
+}
+
+func splitChange(key string, kind ChangeKind, oldValue, newValue string) Change {
+	keyPath, valueName := key, ""
+	if idx := lastIndexByte(key, '\x00'); idx >= 0 {
+		keyPath, valueName = key[:idx], key[idx+1:]
+	}
+	return Change{KeyPath: keyPath, ValueName: valueName, Kind: kind, OldValue: oldValue, NewValue: newValue}
+}
+
+func lastIndexByte(s string, b byte) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == b {
+			return i
+		}
+	}
+	return -1
+}
+
+// collectValues recursively walks key, storing every value it finds under
+// "<subkeyPath>\x00<valueName>" -> stringified value.
+func collectValues(key registry.Key, subkeyPath string, out map[string]string) error {
+	valueNames, err := key.ReadValueNames(-1)
+	if err != nil {
+		return err
+	}
+	for _, name := range valueNames {
+		value, _, err := key.GetStringValue(name)
+		if err != nil {
+			// DWORD/QWORD values are compared by their numeric value; anything
+			// else (binary, multi-string, ...) falls back to its raw bytes.
+			if intVal, _, intErr := key.GetIntegerValue(name); intErr == nil {
+				value = strconv.FormatUint(intVal, 10)
+			} else if n, _, rawErr := key.GetValue(name, nil); rawErr == nil {
+				raw := make([]byte, n)
+				if _, _, rawErr := key.GetValue(name, raw); rawErr == nil {
+					value = string(raw)
+				}
+			}
+		}
+		out[subkeyPath+"\x00"+name] = value
+	}
+
+	subkeyNames, err := key.ReadSubKeyNames(-1)
+	if err != nil {
+		return err
+	}
+	for _, name := range subkeyNames {
+		child, err := registry.OpenKey(key, name, registry.ALL_ACCESS)
+		if err != nil {
+			continue
+		}
+		err = collectValues(child, subkeyPath+`\`+name, out)
+		child.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,424 @@
+// Package shortcut implements a pure-Go reader/writer for the Windows
+// Shell Link Binary File Format (MS-SHLLINK), i.e. ".lnk" files.
+//
+// It exists so portapps launchers can read and generate shortcuts without
+// spinning up WScript.Shell through OLE, which requires CoInitializeEx,
+// locks an OS thread and is comparatively slow when generating many
+// shortcuts during an install. Only the subset of the format portapps
+// actually produces is supported: a single LinkInfo block (local volume)
+// and the StringData blocks for name, relative path, working directory,
+// command line arguments and icon location, always written as Unicode.
+package shortcut
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"unicode/utf16"
+)
+
+const (
+	headerSize = 0x0000004C
+)
+
+// linkCLSID is the fixed CLSID for the ShellLinkHeader, per MS-SHLLINK 2.1.
+var linkCLSID = [16]byte{
+	0x01, 0x14, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46,
+}
+
+// LinkFlags bits, MS-SHLLINK 2.1.
+const (
+	flagHasLinkTargetIDList = 1 << 0
+	flagHasLinkInfo         = 1 << 1
+	flagHasName             = 1 << 2
+	flagHasRelativePath     = 1 << 3
+	flagHasWorkingDir       = 1 << 4
+	flagHasArguments        = 1 << 5
+	flagHasIconLocation     = 1 << 6
+	flagIsUnicode           = 1 << 7
+)
+
+// Shortcut is the decoded content of a .lnk file.
+type Shortcut struct {
+	TargetPath       string
+	Arguments        string
+	Description      string
+	IconLocation     string
+	WorkingDirectory string
+	RelativePath     string
+}
+
+// Read parses the .lnk file at path into a Shortcut.
+func Read(path string) (*Shortcut, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(data)
+
+	var hdr struct {
+		HeaderSize     uint32
+		LinkCLSID      [16]byte
+		LinkFlags      uint32
+		FileAttributes uint32
+		CreationTime   uint64
+		AccessTime     uint64
+		WriteTime      uint64
+		FileSize       uint32
+		IconIndex      int32
+		ShowCommand    uint32
+		HotKey         uint16
+		Reserved1      uint16
+		Reserved2      uint32
+		Reserved3      uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.HeaderSize != headerSize || hdr.LinkCLSID != linkCLSID {
+		return nil, errors.New("shortcut: not a valid .lnk file")
+	}
+
+	if hdr.LinkFlags&flagHasLinkTargetIDList != 0 {
+		var idListSize uint16
+		if err := binary.Read(r, binary.LittleEndian, &idListSize); err != nil {
+			return nil, err
+		}
+		if _, err := r.Seek(int64(idListSize), 1); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Shortcut{}
+
+	if hdr.LinkFlags&flagHasLinkInfo != 0 {
+		linkInfoStart, _ := r.Seek(0, 1)
+
+		var linkInfoSize, linkInfoHeaderSize, linkInfoFlags uint32
+		var volumeIDOffset, localBasePathOffset uint32
+		var commonNetworkRelativeLinkOffset, commonPathSuffixOffset uint32
+		binary.Read(r, binary.LittleEndian, &linkInfoSize)
+		binary.Read(r, binary.LittleEndian, &linkInfoHeaderSize)
+		binary.Read(r, binary.LittleEndian, &linkInfoFlags)
+		binary.Read(r, binary.LittleEndian, &volumeIDOffset)
+		binary.Read(r, binary.LittleEndian, &localBasePathOffset)
+		binary.Read(r, binary.LittleEndian, &commonNetworkRelativeLinkOffset)
+		binary.Read(r, binary.LittleEndian, &commonPathSuffixOffset)
+
+		// LinkInfoHeaderSize >= 0x24 means the optional Unicode offsets
+		// (MS-SHLLINK 2.3) follow CommonPathSuffixOffset; prefer them over
+		// the ANSI LocalBasePath, which can't represent non-ASCII paths.
+		var localBasePathOffsetUnicode uint32
+		if linkInfoHeaderSize >= 0x24 {
+			var commonPathSuffixOffsetUnicode uint32
+			binary.Read(r, binary.LittleEndian, &localBasePathOffsetUnicode)
+			binary.Read(r, binary.LittleEndian, &commonPathSuffixOffsetUnicode)
+		}
+
+		if linkInfoFlags&1 != 0 {
+			switch {
+			case localBasePathOffsetUnicode != 0:
+				basePath, err := readNullTerminatedUTF16(data, int(linkInfoStart)+int(localBasePathOffsetUnicode))
+				if err != nil {
+					return nil, err
+				}
+				s.TargetPath = basePath
+			case localBasePathOffset != 0:
+				basePath, err := readNullTerminatedASCII(data, int(linkInfoStart)+int(localBasePathOffset))
+				if err != nil {
+					return nil, err
+				}
+				s.TargetPath = basePath
+			}
+		}
+
+		if _, err := r.Seek(linkInfoStart+int64(linkInfoSize), 0); err != nil {
+			return nil, err
+		}
+	}
+
+	readString := func(unicode bool) (string, error) {
+		var count uint16
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+			return "", err
+		}
+		if !unicode {
+			buf := make([]byte, count)
+			if _, err := r.Read(buf); err != nil {
+				return "", err
+			}
+			return string(buf), nil
+		}
+		buf := make([]uint16, count)
+		if err := binary.Read(r, binary.LittleEndian, &buf); err != nil {
+			return "", err
+		}
+		return string(utf16.Decode(buf)), nil
+	}
+
+	unicode := hdr.LinkFlags&flagIsUnicode != 0
+
+	if hdr.LinkFlags&flagHasName != 0 {
+		if s.Description, err = readString(unicode); err != nil {
+			return nil, err
+		}
+	}
+	if hdr.LinkFlags&flagHasRelativePath != 0 {
+		if s.RelativePath, err = readString(unicode); err != nil {
+			return nil, err
+		}
+	}
+	if hdr.LinkFlags&flagHasWorkingDir != 0 {
+		if s.WorkingDirectory, err = readString(unicode); err != nil {
+			return nil, err
+		}
+	}
+	if hdr.LinkFlags&flagHasArguments != 0 {
+		if s.Arguments, err = readString(unicode); err != nil {
+			return nil, err
+		}
+	}
+	if hdr.LinkFlags&flagHasIconLocation != 0 {
+		if s.IconLocation, err = readString(unicode); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func readNullTerminatedASCII(data []byte, offset int) (string, error) {
+	if offset < 0 || offset >= len(data) {
+		return "", errors.New("shortcut: offset out of range")
+	}
+	end := offset
+	for end < len(data) && data[end] != 0 {
+		end++
+	}
+	return string(data[offset:end]), nil
+}
+
+func readNullTerminatedUTF16(data []byte, offset int) (string, error) {
+	if offset < 0 || offset+1 >= len(data) {
+		return "", errors.New("shortcut: offset out of range")
+	}
+	var units []uint16
+	for i := offset; i+1 < len(data); i += 2 {
+		unit := binary.LittleEndian.Uint16(data[i : i+2])
+		if unit == 0 {
+			break
+		}
+		units = append(units, unit)
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// Write encodes the Shortcut and saves it as a .lnk file at path.
+func (s *Shortcut) Write(path string) error {
+	var buf bytes.Buffer
+
+	flags := uint32(flagIsUnicode | flagHasLinkInfo)
+	if s.Description != "" {
+		flags |= flagHasName
+	}
+	if s.RelativePath != "" {
+		flags |= flagHasRelativePath
+	}
+	if s.WorkingDirectory != "" {
+		flags |= flagHasWorkingDir
+	}
+	if s.Arguments != "" {
+		flags |= flagHasArguments
+	}
+	if s.IconLocation != "" {
+		flags |= flagHasIconLocation
+	}
+
+	hdr := struct {
+		HeaderSize     uint32
+		LinkCLSID      [16]byte
+		LinkFlags      uint32
+		FileAttributes uint32
+		CreationTime   uint64
+		AccessTime     uint64
+		WriteTime      uint64
+		FileSize       uint32
+		IconIndex      int32
+		ShowCommand    uint32
+		HotKey         uint16
+		Reserved1      uint16
+		Reserved2      uint32
+		Reserved3      uint32
+	}{
+		HeaderSize:  headerSize,
+		LinkCLSID:   linkCLSID,
+		LinkFlags:   flags,
+		ShowCommand: 1, // SW_SHOWNORMAL
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, &hdr); err != nil {
+		return err
+	}
+
+	if err := writeLinkInfo(&buf, s.TargetPath); err != nil {
+		return err
+	}
+
+	writeString := func(value string) error {
+		encoded := utf16.Encode([]rune(value))
+		if err := binary.Write(&buf, binary.LittleEndian, uint16(len(encoded))); err != nil {
+			return err
+		}
+		return binary.Write(&buf, binary.LittleEndian, encoded)
+	}
+
+	if s.Description != "" {
+		if err := writeString(s.Description); err != nil {
+			return err
+		}
+	}
+	if s.RelativePath != "" {
+		if err := writeString(s.RelativePath); err != nil {
+			return err
+		}
+	}
+	if s.WorkingDirectory != "" {
+		if err := writeString(s.WorkingDirectory); err != nil {
+			return err
+		}
+	}
+	if s.Arguments != "" {
+		if err := writeString(s.Arguments); err != nil {
+			return err
+		}
+	}
+	if s.IconLocation != "" {
+		if err := writeString(s.IconLocation); err != nil {
+			return err
+		}
+	}
+
+	// TerminalBlock: an empty ExtraDataBlock closes the extra data section.
+	if err := binary.Write(&buf, binary.LittleEndian, uint32(0)); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// writeLinkInfo emits a LinkInfo block with a single VolumeID/LocalBasePath
+// pointing at targetPath, which is all portapps ever needs to express.
+//
+// LocalBasePath is written twice: once as the ANSI string the base
+// LinkInfo header always carries, and once more through the MS-SHLLINK 2.3
+// Unicode extension (LocalBasePathOffsetUnicode). The ANSI copy can't
+// represent any rune above U+007F, so non-ASCII paths (a profile directory
+// under an accented/CJK/Cyrillic Windows username, for example) would come
+// out mangled for readers that only look at it; the Unicode copy carries
+// the real path and is what Read prefers when both are present.
+func writeLinkInfo(buf *bytes.Buffer, targetPath string) error {
+	const linkInfoHeaderSize = 0x24 // includes the Unicode offset fields
+
+	volumeLabel := []byte{0}
+	volumeID := struct {
+		VolumeIDSize      uint32
+		DriveType         uint32
+		DriveSerialNumber uint32
+		VolumeLabelOffset uint32
+	}{
+		DriveType:         3, // DRIVE_FIXED
+		VolumeLabelOffset: 16,
+	}
+	volumeID.VolumeIDSize = 16 + uint32(len(volumeLabel))
+
+	ansiBasePath := append(asciiFallback(targetPath), 0)
+	unicodeBasePath := utf16LEBytes(targetPath)
+
+	volumeIDOffset := uint32(linkInfoHeaderSize)
+	localBasePathOffset := volumeIDOffset + volumeID.VolumeIDSize
+	commonPathSuffixOffset := localBasePathOffset + uint32(len(ansiBasePath))
+	// +1 for the ANSI CommonPathSuffix's own null terminator, written below.
+	localBasePathOffsetUnicode := commonPathSuffixOffset + 1
+	commonPathSuffixOffsetUnicode := localBasePathOffsetUnicode + uint32(len(unicodeBasePath))
+	// +2 for the Unicode CommonPathSuffix's own null terminator (UTF-16).
+	linkInfoSize := commonPathSuffixOffsetUnicode + 2
+
+	linkInfo := struct {
+		LinkInfoSize                    uint32
+		LinkInfoHeaderSize              uint32
+		LinkInfoFlags                   uint32
+		VolumeIDOffset                  uint32
+		LocalBasePathOffset             uint32
+		CommonNetworkRelativeLinkOffset uint32
+		CommonPathSuffixOffset          uint32
+		LocalBasePathOffsetUnicode      uint32
+		CommonPathSuffixOffsetUnicode   uint32
+	}{
+		LinkInfoSize:        linkInfoSize,
+		LinkInfoHeaderSize:  linkInfoHeaderSize,
+		LinkInfoFlags:       1, // VolumeIDAndLocalBasePath
+		VolumeIDOffset:      volumeIDOffset,
+		LocalBasePathOffset: localBasePathOffset,
+		// CommonNetworkRelativeLinkOffset left at 0: no network link present.
+		CommonPathSuffixOffset:        commonPathSuffixOffset, // empty path suffix string
+		LocalBasePathOffsetUnicode:    localBasePathOffsetUnicode,
+		CommonPathSuffixOffsetUnicode: commonPathSuffixOffsetUnicode, // empty path suffix string
+	}
+
+	if err := binary.Write(buf, binary.LittleEndian, &linkInfo); err != nil {
+		return err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, &volumeID); err != nil {
+		return err
+	}
+	if _, err := buf.Write(volumeLabel); err != nil {
+		return err
+	}
+	if _, err := buf.Write(ansiBasePath); err != nil {
+		return err
+	}
+	// ANSI CommonPathSuffix: empty null-terminated string.
+	if err := buf.WriteByte(0); err != nil {
+		return err
+	}
+	if _, err := buf.Write(unicodeBasePath); err != nil {
+		return err
+	}
+	// Unicode CommonPathSuffix: empty null-terminated string.
+	if err := binary.Write(buf, binary.LittleEndian, uint16(0)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// asciiFallback renders s for the ANSI LocalBasePath field, replacing any
+// rune outside the ASCII range with '_' since that field has no encoding
+// capable of representing it. The Unicode LocalBasePath field written
+// alongside it carries the real path; this is only a fallback for readers
+// that don't look at the Unicode extension.
+func asciiFallback(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0 && r < 0x80 {
+			out = append(out, byte(r))
+		} else {
+			out = append(out, '_')
+		}
+	}
+	return out
+}
+
+// utf16LEBytes encodes s as null-terminated UTF-16LE, the form of the
+// LinkInfo Unicode string fields.
+func utf16LEBytes(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	// +1 unit for the null terminator, left as zero.
+	out := make([]byte, (len(encoded)+1)*2)
+	for i, unit := range encoded {
+		binary.LittleEndian.PutUint16(out[i*2:], unit)
+	}
+	return out
+}
@@ -0,0 +1,56 @@
+package shortcut
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReadWriteRoundTrip(t *testing.T) {
+	cases := []struct {
+		name       string
+		targetPath string
+	}{
+		{"ascii", `C:\Users\bob\AppData\Roaming\App\app.exe`},
+		{"accented", `C:\Users\café\AppData\Roaming\App\app.exe`},
+		{"cjk", `C:\Users\日本語\AppData\Roaming\App\app.exe`},
+		{"cyrillic", `C:\Users\Пользователь\AppData\Roaming\App\app.exe`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			want := &Shortcut{
+				TargetPath:       c.targetPath,
+				Arguments:        "--portable",
+				Description:      "Test App",
+				IconLocation:     c.targetPath,
+				WorkingDirectory: filepath.Dir(c.targetPath),
+			}
+
+			path := filepath.Join(t.TempDir(), "test.lnk")
+			if err := want.Write(path); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+
+			got, err := Read(path)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+
+			if got.TargetPath != want.TargetPath {
+				t.Errorf("TargetPath = %q, want %q", got.TargetPath, want.TargetPath)
+			}
+			if got.Arguments != want.Arguments {
+				t.Errorf("Arguments = %q, want %q", got.Arguments, want.Arguments)
+			}
+			if got.Description != want.Description {
+				t.Errorf("Description = %q, want %q", got.Description, want.Description)
+			}
+			if got.IconLocation != want.IconLocation {
+				t.Errorf("IconLocation = %q, want %q", got.IconLocation, want.IconLocation)
+			}
+			if got.WorkingDirectory != want.WorkingDirectory {
+				t.Errorf("WorkingDirectory = %q, want %q", got.WorkingDirectory, want.WorkingDirectory)
+			}
+		})
+	}
+}
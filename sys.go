@@ -1,21 +1,30 @@
 package portapps
 
 import (
-	"io"
 	"io/ioutil"
 	"os"
-	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"github.com/go-ole/go-ole"
 	"github.com/go-ole/go-ole/oleutil"
 	"golang.org/x/sys/windows"
+
+	"github.com/portapps/portapps/v3/shortcut"
 )
 
+// UseNativeShortcuts makes CreateShortcut go through the pure-Go shortcut
+// package instead of WScript.Shell/OLE. Portable app launchers that create
+// many shortcuts at install time, or that run on a cross-compiled build
+// host without COM, should set this to true. The OLE backend remains the
+// default since it tolerates a few edge cases (e.g. shell verbs) the
+// native writer doesn't implement yet.
+var UseNativeShortcuts = false
+
 // WindowsShortcut the Windows shortcut structure
 type WindowsShortcut struct {
 	ShortcutPath     string
@@ -24,6 +33,8 @@ type WindowsShortcut struct {
 	Description      WindowsShortcutProperty
 	IconLocation     WindowsShortcutProperty
 	WorkingDirectory WindowsShortcutProperty
+	Hotkey           WindowsShortcutProperty
+	WindowStyle      WindowsShortcutProperty
 }
 
 // WindowsShortcutProperty the Windows shortcut property
@@ -33,8 +44,35 @@ type WindowsShortcutProperty struct {
 }
 
 // CreateShortcut creates a windows shortcut
-func CreateShortcut(shortcut WindowsShortcut) error {
-	Log.Infof("Create shortcut for %s in %s...", shortcut.TargetPath, shortcut.ShortcutPath)
+func CreateShortcut(windowsShortcut WindowsShortcut) error {
+	Log.Infof("Create shortcut for %s in %s...", windowsShortcut.TargetPath, windowsShortcut.ShortcutPath)
+
+	if UseNativeShortcuts {
+		if err := createNativeShortcut(windowsShortcut); err != nil {
+			Log.Warnf("Native shortcut backend failed, falling back to OLE: %v", err)
+		} else {
+			return nil
+		}
+	}
+
+	return createOleShortcut(windowsShortcut)
+}
+
+// createNativeShortcut writes a shortcut through the shortcut package,
+// without going through WScript.Shell/OLE.
+func createNativeShortcut(windowsShortcut WindowsShortcut) error {
+	s := &shortcut.Shortcut{
+		TargetPath:       windowsShortcut.TargetPath,
+		Arguments:        windowsShortcut.Arguments.Value,
+		Description:      windowsShortcut.Description.Value,
+		IconLocation:     windowsShortcut.IconLocation.Value,
+		WorkingDirectory: windowsShortcut.WorkingDirectory.Value,
+	}
+	return s.Write(windowsShortcut.ShortcutPath)
+}
+
+// createOleShortcut creates a windows shortcut through WScript.Shell/OLE
+func createOleShortcut(shortcut WindowsShortcut) error {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
@@ -77,14 +115,125 @@ func CreateShortcut(shortcut WindowsShortcut) error {
 	return err
 }
 
+// ReadShortcut reads an existing windows shortcut
+func ReadShortcut(path string) (WindowsShortcut, error) {
+	shortcut := WindowsShortcut{ShortcutPath: path}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	ole.CoInitializeEx(0, ole.COINIT_APARTMENTTHREADED|ole.COINIT_SPEED_OVER_MEMORY)
+	defer ole.CoUninitialize()
+
+	oleShellObject, err := oleutil.CreateObject("WScript.Shell")
+	if err != nil {
+		return shortcut, err
+	}
+
+	defer oleShellObject.Release()
+	wshell, err := oleShellObject.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return shortcut, err
+	}
+
+	defer wshell.Release()
+	cs, err := oleutil.CallMethod(wshell, "CreateShortcut", path)
+	if err != nil {
+		return shortcut, err
+	}
+
+	idispatch := cs.ToIDispatch()
+
+	targetPath, err := oleutil.GetProperty(idispatch, "TargetPath")
+	if err != nil {
+		return shortcut, err
+	}
+	shortcut.TargetPath = targetPath.ToString()
+
+	if v, err := oleutil.GetProperty(idispatch, "Arguments"); err == nil {
+		shortcut.Arguments.Value = v.ToString()
+	}
+	if v, err := oleutil.GetProperty(idispatch, "Description"); err == nil {
+		shortcut.Description.Value = v.ToString()
+	}
+	if v, err := oleutil.GetProperty(idispatch, "IconLocation"); err == nil {
+		shortcut.IconLocation.Value = v.ToString()
+	}
+	if v, err := oleutil.GetProperty(idispatch, "WorkingDirectory"); err == nil {
+		shortcut.WorkingDirectory.Value = v.ToString()
+	}
+	if v, err := oleutil.GetProperty(idispatch, "Hotkey"); err == nil {
+		shortcut.Hotkey.Value = v.ToString()
+	}
+	if v, err := oleutil.GetProperty(idispatch, "WindowStyle"); err == nil {
+		shortcut.WindowStyle.Value = v.ToString()
+	}
+
+	return shortcut, nil
+}
+
+// UpdateShortcut updates an existing windows shortcut, only overwriting fields set in patch
+func UpdateShortcut(path string, patch WindowsShortcut) error {
+	Log.Infof("Update shortcut %s...", path)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	ole.CoInitializeEx(0, ole.COINIT_APARTMENTTHREADED|ole.COINIT_SPEED_OVER_MEMORY)
+	defer ole.CoUninitialize()
+
+	oleShellObject, err := oleutil.CreateObject("WScript.Shell")
+	if err != nil {
+		return err
+	}
+
+	defer oleShellObject.Release()
+	wshell, err := oleShellObject.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return err
+	}
+
+	defer wshell.Release()
+	cs, err := oleutil.CallMethod(wshell, "CreateShortcut", path)
+	if err != nil {
+		return err
+	}
+
+	idispatch := cs.ToIDispatch()
+
+	if patch.TargetPath != "" {
+		oleutil.PutProperty(idispatch, "TargetPath", patch.TargetPath)
+	}
+	if patch.Arguments.Value != "" || patch.Arguments.Clear {
+		oleutil.PutProperty(idispatch, "Arguments", patch.Arguments.Value)
+	}
+	if patch.Description.Value != "" || patch.Description.Clear {
+		oleutil.PutProperty(idispatch, "Description", patch.Description.Value)
+	}
+	if patch.IconLocation.Value != "" || patch.IconLocation.Clear {
+		oleutil.PutProperty(idispatch, "IconLocation", patch.IconLocation.Value)
+	}
+	if patch.WorkingDirectory.Value != "" || patch.WorkingDirectory.Clear {
+		oleutil.PutProperty(idispatch, "WorkingDirectory", patch.WorkingDirectory.Value)
+	}
+	if patch.Hotkey.Value != "" || patch.Hotkey.Clear {
+		oleutil.PutProperty(idispatch, "Hotkey", patch.Hotkey.Value)
+	}
+	if patch.WindowStyle.Value != "" || patch.WindowStyle.Clear {
+		oleutil.PutProperty(idispatch, "WindowStyle", patch.WindowStyle.Value)
+	}
+
+	_, err = oleutil.CallMethod(idispatch, "Save")
+	return err
+}
+
 // SetFileAttributes set attributes to a file
 func SetFileAttributes(path string, attrs uint32) error {
-	pointer, err := syscall.UTF16PtrFromString(path)
+	ptr, err := toExtendedPath(path)
 	if err != nil {
 		return err
 	}
 
-	return syscall.SetFileAttributes(pointer, attrs)
+	return windows.SetFileAttributes(ptr, attrs)
 }
 
 // SetConsoleTitle sets windows console title
@@ -109,55 +258,317 @@ func SetConsoleTitle(title string) (int, error) {
 	return int(r), err
 }
 
-// CopyFile copy a file
+// ErrorAction tells a CopyOptions.OnError caller how to proceed after a
+// copy error.
+type ErrorAction int
+
+const (
+	// Abort stops the whole CopyFile/CopyFolder call and returns the error.
+	Abort ErrorAction = iota
+	// Skip leaves the offending file out and continues with the rest.
+	Skip
+	// Retry attempts the same file copy once more.
+	Retry
+)
+
+// OverwritePolicy controls what CopyFile does when dest already exists.
+type OverwritePolicy int
+
+const (
+	// OverwriteAlways always replaces an existing destination file.
+	OverwriteAlways OverwritePolicy = iota
+	// OverwriteNever leaves an existing destination file untouched.
+	OverwriteNever
+	// OverwriteIfNewer only replaces dest when src has a later mod time.
+	OverwriteIfNewer
+)
+
+// CopyOptions configures CopyFile and CopyFolder.
+type CopyOptions struct {
+	// Progress, when set, is called after each buffer write during a file copy.
+	Progress func(bytesCopied, totalBytes int64)
+	// BufferSize is the chunk size used to stream a file copy. Defaults to 1MiB.
+	BufferSize int
+	// PreserveAttributes copies FILE_ATTRIBUTE_HIDDEN/READONLY/SYSTEM to dest.
+	PreserveAttributes bool
+	// PreserveTimestamps copies creation/modification times to dest.
+	PreserveTimestamps bool
+	// FollowSymlinks copies the target of a symlink/junction instead of
+	// recreating the reparse point itself.
+	FollowSymlinks bool
+	// OnError is consulted when copying a given path fails. A nil OnError
+	// aborts the whole operation on the first error, same as before.
+	OnError func(path string, err error) ErrorAction
+	// Overwrite controls what happens when dest already exists.
+	Overwrite OverwritePolicy
+}
+
+// DefaultCopyOptions returns the options CopyFile/CopyFolder use when
+// called without explicit options.
+func DefaultCopyOptions() CopyOptions {
+	return CopyOptions{
+		BufferSize:         1024 * 1024,
+		PreserveAttributes: true,
+		PreserveTimestamps: true,
+		Overwrite:          OverwriteAlways,
+	}
+}
+
+// CopyFile copies a file, using DefaultCopyOptions.
 func CopyFile(src string, dest string) error {
-	srcFile, err := os.Open(src)
+	return CopyFileWithOptions(src, dest, DefaultCopyOptions())
+}
+
+// CopyFileWithOptions copies a file according to opts. The copy is written
+// to a temporary sibling of dest and swapped into place atomically via
+// MoveFileEx, so a process dying mid-copy never leaves a truncated dest.
+// Reparse points (symlinks/junctions) are recreated as symbolic links
+// rather than followed, unless opts.FollowSymlinks is set. All paths are resolved to
+// extended-length form so copies aren't limited to MAX_PATH.
+func CopyFileWithOptions(src string, dest string, opts CopyOptions) error {
+	srcAttrs, err := getFileAttributesData(src)
 	if err != nil {
 		return err
 	}
-	defer srcFile.Close()
 
-	destFile, err := os.Create(dest)
+	if srcAttrs.FileAttributes&windows.FILE_ATTRIBUTE_REPARSE_POINT != 0 && !opts.FollowSymlinks {
+		return copyReparsePoint(src, dest, opts)
+	}
+
+	if opts.Overwrite != OverwriteAlways {
+		if destAttrs, err := getFileAttributesData(dest); err == nil {
+			if opts.Overwrite == OverwriteNever {
+				return nil
+			}
+			srcModTime := time.Unix(0, srcAttrs.LastWriteTime.Nanoseconds())
+			destModTime := time.Unix(0, destAttrs.LastWriteTime.Nanoseconds())
+			if opts.Overwrite == OverwriteIfNewer && !srcModTime.After(destModTime) {
+				return nil
+			}
+		}
+	}
+
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultCopyOptions().BufferSize
+	}
+
+	srcPtr, err := toExtendedPath(src)
 	if err != nil {
 		return err
 	}
-	defer destFile.Close()
-
-	_, err = io.Copy(destFile, srcFile)
+	srcHandle, err := windows.CreateFile(srcPtr, windows.GENERIC_READ, windows.FILE_SHARE_READ, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
 	if err != nil {
 		return err
 	}
+	defer windows.CloseHandle(srcHandle)
 
-	err = destFile.Sync()
+	tmpDest := dest + ".tmp"
+	tmpDestPtr, err := toExtendedPath(tmpDest)
+	if err != nil {
+		return err
+	}
+	destHandle, err := windows.CreateFile(tmpDestPtr, windows.GENERIC_WRITE, 0, nil, windows.CREATE_ALWAYS, windows.FILE_ATTRIBUTE_NORMAL, 0)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
+	totalBytes := int64(srcAttrs.FileSizeHigh)<<32 | int64(srcAttrs.FileSizeLow)
+	var copiedBytes int64
+	buf := make([]byte, opts.BufferSize)
+	for {
+		var n uint32
+		if err := windows.ReadFile(srcHandle, buf, &n, nil); err != nil {
+			windows.CloseHandle(destHandle)
+			os.Remove(tmpDest)
+			return err
+		}
+		if n == 0 {
+			break
+		}
+
+		var written uint32
+		if err := windows.WriteFile(destHandle, buf[:n], &written, nil); err != nil {
+			windows.CloseHandle(destHandle)
+			os.Remove(tmpDest)
+			return err
+		}
 
-// CopyFolder copy a folder
-func CopyFolder(source string, dest string) (err error) {
-	err = os.MkdirAll(dest, 777)
+		copiedBytes += int64(n)
+		if opts.Progress != nil {
+			opts.Progress(copiedBytes, totalBytes)
+		}
+	}
+
+	if err := windows.FlushFileBuffers(destHandle); err != nil {
+		windows.CloseHandle(destHandle)
+		os.Remove(tmpDest)
+		return err
+	}
+	if err := windows.CloseHandle(destHandle); err != nil {
+		os.Remove(tmpDest)
+		return err
+	}
+
+	if opts.PreserveAttributes {
+		windows.SetFileAttributes(tmpDestPtr, srcAttrs.FileAttributes)
+	}
+	if opts.PreserveTimestamps {
+		if tmpHandle, err := windows.CreateFile(tmpDestPtr, windows.FILE_WRITE_ATTRIBUTES, 0, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0); err == nil {
+			windows.SetFileTime(tmpHandle, &srcAttrs.CreationTime, &srcAttrs.LastAccessTime, &srcAttrs.LastWriteTime)
+			windows.CloseHandle(tmpHandle)
+		}
+	}
+
+	destPtr, err := toExtendedPath(dest)
 	if err != nil {
 		return err
 	}
+	return windows.MoveFileEx(tmpDestPtr, destPtr, windows.MOVEFILE_REPLACE_EXISTING|windows.MOVEFILE_WRITE_THROUGH)
+}
 
-	folder, _ := os.Open(source)
-	objects, err := folder.Readdir(-1)
-	for _, object := range objects {
-		sourceFile := path.Join(source, object.Name())
-		destFile := path.Join(dest, object.Name())
-		if object.IsDir() {
-			err = CopyFolder(sourceFile, destFile)
-			if err != nil {
+// copyReparsePoint recreates a symlink at dest instead of copying the
+// file/directory it points to. A junction is recreated as a directory
+// symbolic link to the same target, not as a junction. It honors opts.Overwrite the same
+// way the regular file copy path does. CreateSymbolicLinkW fails with
+// ERROR_ALREADY_EXISTS if dest is already a reparse point, so re-running a
+// copy over a previously-copied symlink/junction needs dest removed first.
+func copyReparsePoint(src string, dest string, opts CopyOptions) error {
+	srcAttrs, srcAttrsErr := getFileAttributesData(src)
+
+	if destAttrs, err := getFileAttributesData(dest); err == nil {
+		if opts.Overwrite == OverwriteNever {
+			return nil
+		}
+		if opts.Overwrite == OverwriteIfNewer && srcAttrsErr == nil {
+			srcModTime := time.Unix(0, srcAttrs.LastWriteTime.Nanoseconds())
+			destModTime := time.Unix(0, destAttrs.LastWriteTime.Nanoseconds())
+			if !srcModTime.After(destModTime) {
+				return nil
+			}
+		}
+
+		destPtr, err := toExtendedPath(dest)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case destAttrs.FileAttributes&windows.FILE_ATTRIBUTE_REPARSE_POINT != 0:
+			// dest is itself a symlink/junction: unlink it directly.
+			// FindFirstFile-based RemoveContents would follow the link and
+			// wipe out whatever real directory it points to.
+			if destAttrs.FileAttributes&windows.FILE_ATTRIBUTE_DIRECTORY != 0 {
+				if err := windows.RemoveDirectory(destPtr); err != nil {
+					return err
+				}
+			} else if err := windows.DeleteFile(destPtr); err != nil {
 				return err
 			}
-		} else {
-			err = CopyFile(sourceFile, destFile)
-			if err != nil {
+		case destAttrs.FileAttributes&windows.FILE_ATTRIBUTE_DIRECTORY != 0:
+			if err := RemoveContents(dest); err != nil {
+				return err
+			}
+			if err := windows.RemoveDirectory(destPtr); err != nil {
 				return err
 			}
+		default:
+			if err := os.Remove(dest); err != nil {
+				return err
+			}
+		}
+	}
+
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+
+	isDir := srcAttrsErr == nil && srcAttrs.FileAttributes&windows.FILE_ATTRIBUTE_DIRECTORY != 0
+
+	flags := uint32(0)
+	if isDir {
+		flags |= windows.SYMBOLIC_LINK_FLAG_DIRECTORY
+	}
+
+	targetPtr, err := windows.UTF16PtrFromString(target)
+	if err != nil {
+		return err
+	}
+	destPtr, err := toExtendedPath(dest)
+	if err != nil {
+		return err
+	}
+
+	return windows.CreateSymbolicLink(destPtr, targetPtr, flags)
+}
+
+// CopyFolder recursively copies a folder, using DefaultCopyOptions.
+func CopyFolder(source string, dest string) error {
+	return CopyFolderWithOptions(source, dest, DefaultCopyOptions())
+}
+
+// CopyFolderWithOptions recursively copies source into dest according to
+// opts. When opts.OnError is set, a failure on one entry can be skipped or
+// retried instead of aborting the whole copy. source and dest are resolved
+// to extended-length paths throughout, so deeply nested trees (node_modules
+// and the like) don't hit MAX_PATH.
+func CopyFolderWithOptions(source string, dest string, opts CopyOptions) error {
+	if err := mkdirAllExtended(dest); err != nil {
+		return err
+	}
+
+	searchPtr, err := toExtendedPath(filepath.Join(source, "*"))
+	if err != nil {
+		return err
+	}
+
+	var findData windows.Win32finddata
+	handle, err := windows.FindFirstFile(searchPtr, &findData)
+	if err != nil {
+		return err
+	}
+	defer windows.FindClose(handle)
+
+	for {
+		name := windows.UTF16ToString(findData.FileName[:])
+		if name != "." && name != ".." {
+			sourceFile := filepath.Join(source, name)
+			destFile := filepath.Join(dest, name)
+			isDir := findData.FileAttributes&windows.FILE_ATTRIBUTE_DIRECTORY != 0 &&
+				(findData.FileAttributes&windows.FILE_ATTRIBUTE_REPARSE_POINT == 0 || opts.FollowSymlinks)
+
+			for {
+				var copyErr error
+				if isDir {
+					copyErr = CopyFolderWithOptions(sourceFile, destFile, opts)
+				} else {
+					copyErr = CopyFileWithOptions(sourceFile, destFile, opts)
+				}
+
+				if copyErr == nil {
+					break
+				}
+				if opts.OnError == nil {
+					return copyErr
+				}
+
+				switch opts.OnError(sourceFile, copyErr) {
+				case Skip:
+					copyErr = nil
+				case Retry:
+					continue
+				case Abort:
+					return copyErr
+				}
+				break
+			}
+		}
+
+		if err := windows.FindNextFile(handle, &findData); err != nil {
+			if err == windows.ERROR_NO_MORE_FILES {
+				break
+			}
+			return err
 		}
 	}
 
@@ -166,27 +577,68 @@ func CopyFolder(source string, dest string) (err error) {
 
 // RemoveContents remove contents of a specified directory
 func RemoveContents(dir string) error {
-	d, err := os.Open(dir)
+	searchPtr, err := toExtendedPath(filepath.Join(dir, "*"))
 	if err != nil {
 		return err
 	}
-	defer d.Close()
-	names, err := d.Readdirnames(-1)
+
+	var findData windows.Win32finddata
+	handle, err := windows.FindFirstFile(searchPtr, &findData)
 	if err != nil {
+		if err == windows.ERROR_FILE_NOT_FOUND {
+			return nil
+		}
 		return err
 	}
-	for _, name := range names {
-		err = os.RemoveAll(filepath.Join(dir, name))
-		if err != nil {
+	defer windows.FindClose(handle)
+
+	for {
+		name := windows.UTF16ToString(findData.FileName[:])
+		if name != "." && name != ".." {
+			full := filepath.Join(dir, name)
+			extPtr, err := toExtendedPath(full)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case findData.FileAttributes&windows.FILE_ATTRIBUTE_REPARSE_POINT != 0 &&
+				findData.FileAttributes&windows.FILE_ATTRIBUTE_DIRECTORY != 0:
+				// A junction/symlinked directory: unlink the reparse point
+				// itself. RemoveDirectory never follows it into the real
+				// target, unlike FindFirstFile enumeration or DeleteFile
+				// (which fails on directories, reparse point or not).
+				if err := windows.RemoveDirectory(extPtr); err != nil {
+					return err
+				}
+			case findData.FileAttributes&windows.FILE_ATTRIBUTE_DIRECTORY != 0:
+				if err := RemoveContents(full); err != nil {
+					return err
+				}
+				if err := windows.RemoveDirectory(extPtr); err != nil {
+					return err
+				}
+			default:
+				if err := windows.DeleteFile(extPtr); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := windows.FindNextFile(handle, &findData); err != nil {
+			if err == windows.ERROR_NO_MORE_FILES {
+				break
+			}
 			return err
 		}
 	}
+
 	return nil
 }
 
 // CreateFolderCheck to create a folder and get its path and return error
 func CreateFolderCheck(path string) (string, error) {
-	if err := os.MkdirAll(path, 777); err != nil {
+	if err := mkdirAllExtended(path); err != nil {
 		return "", err
 	}
 	return path, nil
@@ -203,16 +655,38 @@ func CreateFolder(path string) string {
 
 // CreateFile creates / overwrites a file with content
 func CreateFile(path string, content string) error {
-	file, err := os.Create(path)
+	return writeFileContents(path, content)
+}
+
+// writeFileContents creates or truncates path and writes content to it via
+// CreateFileW/WriteFileW against an extended-length path.
+func writeFileContents(path string, content string) error {
+	ptr, err := toExtendedPath(path)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	_, err = file.WriteString(content)
-	if err = file.Sync(); err != nil {
+
+	handle, err := windows.CreateFile(
+		ptr,
+		windows.GENERIC_WRITE,
+		0,
+		nil,
+		windows.CREATE_ALWAYS,
+		windows.FILE_ATTRIBUTE_NORMAL,
+		0,
+	)
+	if err != nil {
 		return err
 	}
-	return nil
+	defer windows.CloseHandle(handle)
+
+	data := []byte(content)
+	var written uint32
+	if err := windows.WriteFile(handle, data, &written, nil); err != nil {
+		return err
+	}
+
+	return windows.FlushFileBuffers(handle)
 }
 
 // PathJoin to join paths
@@ -240,29 +714,85 @@ func FormatWindowsPath(path string) string {
 	return strings.Replace(path, `/`, `\`, -1)
 }
 
-// Exists reports whether the named file or directory exists
-func Exists(name string) bool {
-	if _, err := os.Stat(name); err != nil {
-		if os.IsNotExist(err) {
-			return false
-		}
+// toExtendedPath normalizes p to an absolute, backslash-separated path and
+// prefixes it with the `\\?\` (or `\\?\UNC\` for UNC paths) extended-length
+// prefix, so the Windows API calls in this file aren't limited to MAX_PATH
+// (260 characters) — common once portable app trees nest a few levels of
+// node_modules or similar deep dependency trees.
+func toExtendedPath(p string) (*uint16, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
 	}
-	return true
+	abs = FormatWindowsPath(abs)
+
+	switch {
+	case strings.HasPrefix(abs, `\\?\`):
+		// already an extended-length path
+	case strings.HasPrefix(abs, `\\`):
+		abs = `\\?\UNC\` + strings.TrimPrefix(abs, `\\`)
+	default:
+		abs = `\\?\` + abs
+	}
+
+	return windows.UTF16PtrFromString(abs)
 }
 
-// WriteToFile reports writes content to a file
-func WriteToFile(name string, content string) error {
-	fo, err := os.Create(name)
-	defer fo.Close()
+// getFileAttributesData reads the attributes, size and timestamps of path
+// without opening it, via GetFileAttributesExW.
+func getFileAttributesData(path string) (windows.Win32FileAttributeData, error) {
+	var data windows.Win32FileAttributeData
+
+	ptr, err := toExtendedPath(path)
+	if err != nil {
+		return data, err
+	}
+
+	err = windows.GetFileAttributesEx(ptr, windows.GetFileExInfoStandard, (*byte)(unsafe.Pointer(&data)))
+	return data, err
+}
+
+// mkdirAllExtended creates path and any missing parents, via
+// CreateDirectoryW against extended-length paths.
+func mkdirAllExtended(path string) error {
+	if Exists(path) {
+		return nil
+	}
+
+	if parent := filepath.Dir(path); parent != path {
+		if err := mkdirAllExtended(parent); err != nil {
+			return err
+		}
+	}
+
+	ptr, err := toExtendedPath(path)
 	if err != nil {
 		return err
 	}
-	if _, err = io.Copy(fo, strings.NewReader(content)); err != nil {
+
+	if err := windows.CreateDirectory(ptr, nil); err != nil && err != windows.ERROR_ALREADY_EXISTS {
 		return err
 	}
+
 	return nil
 }
 
+// Exists reports whether the named file or directory exists
+func Exists(name string) bool {
+	ptr, err := toExtendedPath(name)
+	if err != nil {
+		return false
+	}
+
+	_, err = windows.GetFileAttributes(ptr)
+	return err == nil
+}
+
+// WriteToFile reports writes content to a file
+func WriteToFile(name string, content string) error {
+	return writeFileContents(name, content)
+}
+
 // RawWinver returns Windows OS version
 // TODO: Replace with `windows.GetVersion()` when this is resolved: https://github.com/golang/go/issues/17835
 func RawWinver() (major, minor, build uint32) {
@@ -308,15 +838,29 @@ func ReplaceByPrefix(filename string, prefix string, replace string) error {
 
 // IsDirEmpty determines if directory is empty
 func IsDirEmpty(name string) (bool, error) {
-	f, err := os.Open(name)
+	searchPtr, err := toExtendedPath(filepath.Join(name, "*"))
 	if err != nil {
 		return false, err
 	}
-	defer f.Close()
 
-	if _, err = f.Readdir(1); err == io.EOF {
-		return true, nil
+	var findData windows.Win32finddata
+	handle, err := windows.FindFirstFile(searchPtr, &findData)
+	if err != nil {
+		return false, err
 	}
+	defer windows.FindClose(handle)
+
+	for {
+		entryName := windows.UTF16ToString(findData.FileName[:])
+		if entryName != "." && entryName != ".." {
+			return false, nil
+		}
 
-	return false, err
+		if err := windows.FindNextFile(handle, &findData); err != nil {
+			if err == windows.ERROR_NO_MORE_FILES {
+				return true, nil
+			}
+			return false, err
+		}
+	}
 }
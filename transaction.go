@@ -0,0 +1,249 @@
+package portapps
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// txEntryKind identifies what kind of mutation a txEntry recorded, so
+// Rollback knows how to undo it.
+type txEntryKind int
+
+const (
+	txFileCreated txEntryKind = iota
+	txFileOverwritten
+	txFolderCreated
+	txShortcutCreated
+)
+
+// txEntry records one mutation performed through a Transaction.
+type txEntry struct {
+	kind       txEntryKind
+	path       string
+	backupPath string // original bytes, for txFileOverwritten
+}
+
+// Transaction groups a sequence of file, folder and shortcut mutations so
+// they can all be undone with Rollback if a later step in the sequence
+// fails. Registry changes are not recorded. Overwritten files are backed up to a temporary
+// journal directory before being replaced, so Rollback can restore them
+// verbatim even after the original bytes are gone from disk.
+//
+//	tx := portapps.Begin()
+//	err := tx.CopyFile(src, dest)
+//	if err == nil {
+//		err = tx.CreateShortcut(shortcut)
+//	}
+//	if err != nil {
+//		tx.Rollback()
+//	} else {
+//		tx.Commit()
+//	}
+type Transaction struct {
+	journalDir string
+	entries    []txEntry
+	done       bool
+}
+
+// Begin starts a new Transaction, creating a temporary journal directory
+// to hold backups of any files it overwrites.
+func Begin() *Transaction {
+	journalDir, err := ioutil.TempDir("", "portapps-tx-")
+	if err != nil {
+		Log.Fatalf("Cannot create transaction journal: %v", err)
+	}
+	return &Transaction{journalDir: journalDir}
+}
+
+func (tx *Transaction) backup(path string) (string, error) {
+	backupPath := filepath.Join(tx.journalDir, fmt.Sprintf("%d", len(tx.entries)))
+	if err := CopyFile(path, backupPath); err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
+
+// CopyFile copies src to dest, recording dest so Rollback can remove it
+// (or restore what it overwrote).
+func (tx *Transaction) CopyFile(src string, dest string) error {
+	entry := txEntry{kind: txFileCreated, path: dest}
+	if Exists(dest) {
+		backupPath, err := tx.backup(dest)
+		if err != nil {
+			return err
+		}
+		entry.kind = txFileOverwritten
+		entry.backupPath = backupPath
+	}
+
+	if err := CopyFile(src, dest); err != nil {
+		return err
+	}
+	tx.entries = append(tx.entries, entry)
+	return nil
+}
+
+// CopyFolder recursively copies source into dest through tx.CreateFolder
+// and tx.CopyFile, so every file and subfolder it touches is individually
+// recorded and Rollback can undo the whole tree, not just its root.
+func (tx *Transaction) CopyFolder(source string, dest string) error {
+	if err := tx.CreateFolder(dest); err != nil {
+		return err
+	}
+
+	folder, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer folder.Close()
+
+	objects, err := folder.Readdir(-1)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		sourceFile := filepath.Join(source, object.Name())
+		destFile := filepath.Join(dest, object.Name())
+
+		if object.IsDir() && object.Mode()&os.ModeSymlink == 0 {
+			if err := tx.CopyFolder(sourceFile, destFile); err != nil {
+				return err
+			}
+		} else if err := tx.CopyFile(sourceFile, destFile); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateFolder creates path, recording it as created if it did not
+// already exist so Rollback can prune it.
+func (tx *Transaction) CreateFolder(path string) error {
+	existed := Exists(path)
+
+	if _, err := CreateFolderCheck(path); err != nil {
+		return err
+	}
+	if !existed {
+		tx.entries = append(tx.entries, txEntry{kind: txFolderCreated, path: path})
+	}
+	return nil
+}
+
+// CreateFile creates or overwrites path with content, backing up any
+// existing content first so Rollback can restore it.
+func (tx *Transaction) CreateFile(path string, content string) error {
+	entry := txEntry{kind: txFileCreated, path: path}
+	if Exists(path) {
+		backupPath, err := tx.backup(path)
+		if err != nil {
+			return err
+		}
+		entry.kind = txFileOverwritten
+		entry.backupPath = backupPath
+	}
+
+	if err := CreateFile(path, content); err != nil {
+		return err
+	}
+	tx.entries = append(tx.entries, entry)
+	return nil
+}
+
+// WriteToFile writes content to name, backing up any existing content
+// first so Rollback can restore it.
+func (tx *Transaction) WriteToFile(name string, content string) error {
+	entry := txEntry{kind: txFileCreated, path: name}
+	if Exists(name) {
+		backupPath, err := tx.backup(name)
+		if err != nil {
+			return err
+		}
+		entry.kind = txFileOverwritten
+		entry.backupPath = backupPath
+	}
+
+	if err := WriteToFile(name, content); err != nil {
+		return err
+	}
+	tx.entries = append(tx.entries, entry)
+	return nil
+}
+
+// ReplaceByPrefix rewrites filename, backing up its current contents
+// first so Rollback can restore them even though ReplaceByPrefix itself
+// overwrites the file in place.
+func (tx *Transaction) ReplaceByPrefix(filename string, prefix string, replace string) error {
+	backupPath, err := tx.backup(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := ReplaceByPrefix(filename, prefix, replace); err != nil {
+		return err
+	}
+	tx.entries = append(tx.entries, txEntry{kind: txFileOverwritten, path: filename, backupPath: backupPath})
+	return nil
+}
+
+// CreateShortcut creates shortcut, backing up an existing .lnk at the
+// same path first so Rollback can restore it.
+func (tx *Transaction) CreateShortcut(shortcut WindowsShortcut) error {
+	entry := txEntry{kind: txShortcutCreated, path: shortcut.ShortcutPath}
+	if Exists(shortcut.ShortcutPath) {
+		backupPath, err := tx.backup(shortcut.ShortcutPath)
+		if err != nil {
+			return err
+		}
+		entry.kind = txFileOverwritten
+		entry.backupPath = backupPath
+	}
+
+	if err := CreateShortcut(shortcut); err != nil {
+		return err
+	}
+	tx.entries = append(tx.entries, entry)
+	return nil
+}
+
+// Commit discards the journal. The mutations already applied to disk are
+// kept as-is.
+func (tx *Transaction) Commit() error {
+	tx.done = true
+	return os.RemoveAll(tx.journalDir)
+}
+
+// Rollback undoes every mutation recorded so far, restoring overwritten
+// files from the journal, removing files and shortcuts it created, and
+// pruning folders it created if they ended up empty.
+func (tx *Transaction) Rollback() error {
+	tx.done = true
+
+	var firstErr error
+	recordErr := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for i := len(tx.entries) - 1; i >= 0; i-- {
+		entry := tx.entries[i]
+		switch entry.kind {
+		case txFileCreated, txShortcutCreated:
+			recordErr(os.Remove(entry.path))
+		case txFileOverwritten:
+			recordErr(CopyFile(entry.backupPath, entry.path))
+		case txFolderCreated:
+			if empty, err := IsDirEmpty(entry.path); err == nil && empty {
+				recordErr(os.Remove(entry.path))
+			}
+		}
+	}
+
+	recordErr(os.RemoveAll(tx.journalDir))
+	return firstErr
+}